@@ -1,3 +1,9 @@
+// This binary is an in-progress rewrite of the HTTP-serving half of the
+// root package main (TLS/HTTP2, per-route timeouts, graceful drain) onto
+// internal/app's env-based config and mux. It does not yet include the
+// database-level features (migrations, pgwait, LISTEN/NOTIFY) built onto
+// the root package; that one remains the canonical deployed entrypoint
+// until the two are reconciled into a single binary.
 package main
 
 import (
@@ -13,6 +19,7 @@ import (
 
 	"github.com/caarlos0/env"
 	"github.com/jake/poc-fly-microservice/internal/app"
+	"github.com/jake/poc-fly-microservice/internal/app/shutdown"
 )
 
 func main() {
@@ -33,12 +40,38 @@ func run(ctx context.Context) error {
 
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-	svr := app.NewServer(ctx, cancel, cfg, logger)
+	sd := shutdown.New(
+		logger,
+		time.Duration(cfg.PreStopDelay)*time.Second,
+		time.Duration(cfg.ShutdownTimeout)*time.Second,
+	)
+
+	svr, watchdog := app.NewServer(ctx, cancel, cfg, logger, sd)
 	httpServer := &http.Server{
 		Addr:    net.JoinHostPort(cfg.AppHost, cfg.AppPort),
 		Handler: svr,
 	}
 
+	if watchdog != nil {
+		// Track connection-level activity (streaming responses, hijacked
+		// upgrades, slow uploads) in addition to the request-level
+		// accounting done by the Middleware wrapped around svr. This
+		// continues to work over TLS/H2: a single multiplexed connection
+		// is still counted as one active conn.
+		httpServer.ConnState = watchdog.ConnState
+	}
+
+	tlsConfig, err := app.NewTLSConfig(ctx, cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to configure tls: %w", err)
+	}
+	httpServer.TLSConfig = tlsConfig
+
+	ln, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", httpServer.Addr, err)
+	}
+
 	// Start the server in a separate goroutine
 	go func() {
 		logger.InfoContext(
@@ -46,7 +79,15 @@ func run(ctx context.Context) error {
 			"server started",
 			slog.String("address", httpServer.Addr))
 
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			// Cert/key files are empty because the certificate is served
+			// via tlsConfig.GetCertificate, which supports hot reload.
+			err = httpServer.ServeTLS(ln, "", "")
+		} else {
+			err = httpServer.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			fmt.Fprintf(os.Stderr, "error listening and serving: %s\n", err)
 		}
 	}()
@@ -57,12 +98,12 @@ func run(ctx context.Context) error {
 	go func() {
 		defer wg.Done()
 		<-ctx.Done()
-		shutdownCtx := context.Background()
-		shutdownCtx, cancel := context.WithTimeout(shutdownCtx, 10*time.Second)
-		defer cancel()
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		if err := sd.Run(context.Background(), httpServer); err != nil {
 			fmt.Fprintf(os.Stderr, "error shutting down http server: %s\n", err)
 		}
+		if watchdog != nil {
+			watchdog.Stop()
+		}
 	}()
 
 	wg.Wait()
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ssePingInterval is how often the item-stream sends a keep-alive comment
+// to idle subscribers.
+const ssePingInterval = 15 * time.Second
+
+// hub is a small in-process pub/sub used to fan out values of type T to any
+// number of subscribers without polling the database. It backs
+// itemChangeHub in listener.go, the Postgres-backed item change feed.
+type hub[T any] struct {
+	mu          sync.Mutex
+	subscribers map[chan T]struct{}
+}
+
+// newHub creates an empty hub.
+func newHub[T any]() *hub[T] {
+	return &hub[T]{
+		subscribers: make(map[chan T]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber and returns its channel along with
+// an unsubscribe function that the caller must invoke when done.
+func (h *hub[T]) Subscribe() (ch chan T, unsubscribe func()) {
+	ch = make(chan T, 16)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Publish sends a value to every current subscriber. Slow subscribers that
+// can't keep up with their buffer are skipped rather than blocking the
+// publisher.
+func (h *hub[T]) Publish(v T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- v:
+		default:
+		}
+	}
+}
+
+// SubscriberCount reports how many subscribers are currently connected.
+func (h *hub[T]) SubscriberCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
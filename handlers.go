@@ -3,23 +3,44 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/jake/poc-fly-microservice/internal/pgwait"
+	"github.com/jake/poc-fly-microservice/pkg/inactivity"
 )
 
 // healthHandler returns an HTTP handler for the health check endpoint.
-// It responds with a simple JSON object indicating the service is operational.
-func healthHandler() http.HandlerFunc {
+// It responds 503 with a structured JSON error if the database pool is
+// currently unreachable, so Fly's health checks correctly gate traffic
+// instead of routing requests the service can't serve.
+func healthHandler(pool *pgwait.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
+
+		if !pool.Healthy() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]any{
+					"code":    http.StatusServiceUnavailable,
+					"message": "database unreachable",
+				},
+			})
+			return
+		}
+
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	}
 }
 
 // createItemHandler returns an HTTP handler for creating new items.
-// It accepts a JSON payload with an item name and stores it in the database.
-// The handler requires a logger for structured logging and a database connection.
+// It accepts a JSON payload with an item name and stores it in the
+// database. Subscribers of /items/stream are notified of the insert via
+// the items_changed Postgres trigger and itemListener, not directly by
+// this handler.
 func createItemHandler(logger *slog.Logger, db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -122,3 +143,97 @@ func listItemsHandler(logger *slog.Logger, db *sql.DB) http.HandlerFunc {
 		json.NewEncoder(w).Encode(items)
 	}
 }
+
+// itemStreamHandler returns an HTTP handler that streams the
+// Postgres-backed item change feed (inserts, updates, and deletes) to the
+// client over text/event-stream. Events are sourced from LISTEN/NOTIFY via
+// listener, so the feed reflects every writer, not just this process. The
+// handler call spans the whole lifetime of the connection, so wrapping it
+// with inactivity.Inactivity's Wrap/WrapExcept is enough to keep the
+// service counted as active for as long as a subscriber is connected; no
+// separate activity bookkeeping is needed here. When reconnectCh fires
+// (shortly before the service scales to zero, see
+// inactivity.WithPreShutdownNotice in main.go), the handler tells the
+// client to reconnect elsewhere and closes the stream.
+func itemStreamHandler(logger *slog.Logger, listener *itemListener, pingInterval time.Duration, reconnectCh <-chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		ch, unsubscribe := listener.Subscribe()
+		defer unsubscribe()
+
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-reconnectCh:
+				fmt.Fprint(w, "event: reconnect\ndata: {\"reason\":\"server shutting down\"}\n\n")
+				flusher.Flush()
+				return
+
+			case event := <-ch:
+				if err := writeItemChangeEvent(w, event); err != nil {
+					logger.ErrorContext(ctx, "error writing item change event",
+						slog.String("error", err.Error()),
+					)
+					return
+				}
+				flusher.Flush()
+
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// debugInactivityHandler exposes the current state of ia as JSON, so an
+// operator can see why a machine is (or isn't) about to scale to zero.
+func debugInactivityHandler(ia *inactivity.Inactivity) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := ia.Stats()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"active_requests":          stats.ActiveRequests,
+			"active_conns":             stats.ActiveConns,
+			"time_since_last_activity": stats.TimeSinceLastActivity.String(),
+			"next_fire_at":             stats.NextFireAt,
+		})
+	}
+}
+
+// writeItemChangeEvent writes a single ItemEvent as an SSE event, named
+// "item-" plus the lowercased operation (item-insert, item-update,
+// item-delete).
+func writeItemChangeEvent(w http.ResponseWriter, event ItemEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: item-%s\ndata: %s\n\n",
+		event.Item.ID, strings.ToLower(event.Op), payload)
+	return err
+}
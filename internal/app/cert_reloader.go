@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often certReloader stats the cert file to
+// check for a newer version.
+const certReloadInterval = 30 * time.Second
+
+// NewTLSConfig builds a *tls.Config backed by a hot-reloading certReloader
+// when cfg.TLSCertFile and cfg.TLSKeyFile are both set. It starts a
+// background goroutine, scoped to ctx, that watches the cert files for
+// changes. It returns (nil, nil) when TLS isn't configured.
+func NewTLSConfig(ctx context.Context, cfg Config, logger *slog.Logger) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, nil
+	}
+
+	reloader, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	go reloader.Watch(ctx, logger, certReloadInterval)
+
+	nextProtos := []string{"http/1.1"}
+	if cfg.EnableHTTP2 {
+		nextProtos = []string{"h2", "http/1.1"}
+	}
+
+	return &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     nextProtos,
+	}, nil
+}
+
+// certReloader serves a TLS certificate from disk and periodically checks
+// whether the underlying files have changed, so operators can rotate
+// certs on Fly without restarting the machine. It's wired into
+// tls.Config.GetCertificate.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the initial certificate pair from certFile/keyFile.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate satisfies tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch polls the cert file's modification time every interval and
+// reloads the key pair when it changes. It runs until ctx is done.
+func (r *certReloader) Watch(ctx context.Context, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			info, err := os.Stat(r.certFile)
+			if err != nil {
+				logger.ErrorContext(ctx, "failed to stat tls cert file", slog.String("error", err.Error()))
+				continue
+			}
+
+			r.mu.RLock()
+			changed := info.ModTime().After(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := r.reload(); err != nil {
+				logger.ErrorContext(ctx, "failed to reload tls certificate", slog.String("error", err.Error()))
+				continue
+			}
+			logger.InfoContext(ctx, "reloaded tls certificate", slog.String("cert_file", r.certFile))
+		}
+	}
+}
+
+// reload reads the certificate pair from disk and swaps it in atomically.
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(r.certFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = info.ModTime()
+	r.mu.Unlock()
+
+	return nil
+}
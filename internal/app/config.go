@@ -6,4 +6,21 @@ type Config struct {
 	EnableInactivityTimeout bool   `env:"ENABLE_INACTIVITY_TIMEOUT"`
 	InactivityTimeout       int    `env:"INACTIVITY_TIMEOUT"`
 	FlyRegion               string `env:"FLY_REGION"`
+	// RouteTimeout is the default number of seconds a route is allowed to
+	// take before it's aborted with a 503. Individual routes may override
+	// this default in addRoutes.
+	RouteTimeout int `env:"ROUTE_TIMEOUT" envDefault:"10"`
+	// TLSCertFile and TLSKeyFile enable TLS when both are set. The files
+	// are watched and hot-reloaded, so certs can be rotated without
+	// restarting the machine.
+	TLSCertFile string `env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE"`
+	// EnableHTTP2 advertises h2 via ALPN when TLS is enabled.
+	EnableHTTP2 bool `env:"ENABLE_HTTP2"`
+	// PreStopDelay is how many seconds to wait, after /ready starts
+	// reporting unhealthy, before the server shutdown begins.
+	PreStopDelay int `env:"PRE_STOP_DELAY" envDefault:"0"`
+	// ShutdownTimeout bounds, in seconds, how long graceful shutdown is
+	// allowed to take before remaining connections are force-closed.
+	ShutdownTimeout int `env:"SHUTDOWN_TIMEOUT" envDefault:"10"`
 }
@@ -2,76 +2,66 @@ package app
 
 import (
 	"context"
+	"embed"
 	"log/slog"
 	"net/http"
-	"sync"
 	"text/template"
 	"time"
+
+	"github.com/jake/poc-fly-microservice/internal/app/shutdown"
+	"github.com/jake/poc-fly-microservice/pkg/inactivity"
 )
 
-// NewServer creates a new HTTP server
-func NewServer(ctx context.Context, stop context.CancelFunc, cfg Config, logger *slog.Logger) http.Handler {
+//go:embed templates/*
+var resources embed.FS
+
+// NewServer creates a new HTTP server. When cfg.EnableInactivityTimeout is
+// set, it also returns a *inactivity.Watchdog whose ConnState method the
+// caller should wire into http.Server.ConnState, so connection-level
+// activity (streaming responses, hijacked upgrades, slow uploads) keeps the
+// service alive in addition to the request-level Middleware applied here.
+// sd is wrapped around every route so it can track in-flight requests and
+// serve /ready; the caller is responsible for invoking sd.Run once it
+// decides to shut down.
+func NewServer(ctx context.Context, stop context.CancelFunc, cfg Config, logger *slog.Logger, sd *shutdown.Shutdown) (http.Handler, *inactivity.Watchdog) {
 	t := template.Must(template.ParseFS(resources, "templates/*"))
 	mux := http.NewServeMux()
 
-	addRoutes(mux, cfg, logger, t)
+	addRoutes(mux, cfg, logger, t, sd)
 
-	var handler http.Handler = mux
+	var handler http.Handler = sd.Middleware(mux)
 
-	// Add inactivity timeout middleware
-	if cfg.EnableInactivityTimeout {
-		handler = configureInactivityTimeout(ctx, stop, cfg, logger, handler)
+	if !cfg.EnableInactivityTimeout {
+		return handler, nil
 	}
 
-	return handler
-}
-
-// configureInactivityTimeout configures the inactivity timeout middleware
-// on the handler
-func configureInactivityTimeout(
-	ctx context.Context,
-	stop context.CancelFunc,
-	cfg Config,
-	logger *slog.Logger,
-	handler http.Handler) http.Handler {
-	var (
-		mu         sync.Mutex
-		activeReqs sync.WaitGroup
-	)
-
-	duration := time.Duration(cfg.InactivityTimeout) * time.Second
+	timeout := time.Duration(cfg.InactivityTimeout) * time.Second
+	watchdog := inactivity.NewWatchdog(timeout, logger.Handler(), stop)
+	handler = watchdog.Middleware(handler)
 
-	// Create a timer that will trigger after the timeout period
-	// This period can be reset (see middleware)
-	// If a request is actively processing this will also wait for the
-	// request to complete
-	timer := time.AfterFunc(duration, func() {
-		activeReqs.Wait()
-		logger.InfoContext(
-			ctx,
-			"no activity for timeout period — shutting down",
-			slog.Int("timeout_period", cfg.InactivityTimeout))
-		stop()
-	})
-
-	resetTimerMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			activeReqs.Add(1)
-			defer activeReqs.Done()
+	return handler, watchdog
+}
 
-			mu.Lock()
-			timer.Reset(duration)
-			mu.Unlock()
+// routeTimeouts overrides cfg.RouteTimeout for specific routes. Routes not
+// listed here fall back to the default.
+var routeTimeouts = map[string]time.Duration{
+	"GET /health": 2 * time.Second,
+	"GET /ready":  2 * time.Second,
+}
 
-			next.ServeHTTP(w, r)
-		})
+// addRoutes adds the application routes to the mux, wrapping each one with
+// withTimeout so a slow handler can't hang a connection indefinitely.
+func addRoutes(mux *http.ServeMux, cfg Config, logger *slog.Logger, t *template.Template, sd *shutdown.Shutdown) {
+	defaultTimeout := time.Duration(cfg.RouteTimeout) * time.Second
 
+	register := func(pattern string, handler http.Handler) {
+		timeout := defaultTimeout
+		if override, ok := routeTimeouts[pattern]; ok {
+			timeout = override
+		}
+		mux.Handle(pattern, withTimeout(handler, timeout))
 	}
 
-	return resetTimerMiddleware(handler)
-}
-
-// addRoutes adds the application routes to the mux
-func addRoutes(mux *http.ServeMux, cfg Config, logger *slog.Logger, t *template.Template) {
-	mux.Handle("GET /health", healthHandler(cfg, logger, t))
+	register("GET /health", healthHandler(cfg, logger.Handler(), t))
+	register("GET /ready", sd.ReadyHandler())
 }
@@ -0,0 +1,107 @@
+// Package shutdown implements a first-class graceful shutdown subsystem:
+// a readiness endpoint that flips to unhealthy the instant shutdown
+// begins (so Fly's proxy stops routing new traffic), a pre-stop delay to
+// let in-flight load-balancer health checks observe that flip, and a
+// bounded drain that force-closes any connections still open once the
+// shutdown timeout elapses.
+package shutdown
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Shutdown tracks service readiness and drives a graceful http.Server
+// shutdown when triggered.
+type Shutdown struct {
+	logger          *slog.Logger
+	preStopDelay    time.Duration
+	shutdownTimeout time.Duration
+
+	mu    sync.RWMutex
+	ready bool
+
+	activeReqs int64
+}
+
+// New creates a Shutdown subsystem. preStopDelay is how long to wait
+// after readiness flips before the server shutdown begins; shutdownTimeout
+// bounds how long the drain is allowed to take before connections are
+// force-closed.
+func New(logger *slog.Logger, preStopDelay, shutdownTimeout time.Duration) *Shutdown {
+	return &Shutdown{
+		logger:          logger,
+		preStopDelay:    preStopDelay,
+		shutdownTimeout: shutdownTimeout,
+		ready:           true,
+	}
+}
+
+// Middleware tracks in-flight requests so Run can log how many were
+// draining when shutdown began.
+func (s *Shutdown) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.activeReqs, 1)
+		defer atomic.AddInt64(&s.activeReqs, -1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReadyHandler reports 200 while the service is accepting traffic and 503
+// from the moment Run begins shutting down.
+func (s *Shutdown) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		ready := s.ready
+		s.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"status": "shutting_down"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+	}
+}
+
+// Run flips readiness to unhealthy, waits preStopDelay, then shuts srv
+// down within shutdownTimeout — force-closing it if the deadline elapses.
+// It logs a structured summary of the drain before returning.
+func (s *Shutdown) Run(ctx context.Context, srv *http.Server) error {
+	activeAtStart := atomic.LoadInt64(&s.activeReqs)
+
+	s.mu.Lock()
+	s.ready = false
+	s.mu.Unlock()
+	s.logger.InfoContext(ctx, "shutdown beginning", slog.Int64("active_reqs", activeAtStart))
+
+	if s.preStopDelay > 0 {
+		time.Sleep(s.preStopDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	forced := err != nil
+	if forced {
+		if closeErr := srv.Close(); closeErr != nil {
+			s.logger.ErrorContext(ctx, "error force-closing server", slog.String("error", closeErr.Error()))
+		}
+	}
+
+	s.logger.InfoContext(ctx, "shutdown complete",
+		slog.Int64("active_reqs_at_start", activeAtStart),
+		slog.Int64("active_reqs_remaining", atomic.LoadInt64(&s.activeReqs)),
+		slog.Bool("forced", forced),
+	)
+
+	return err
+}
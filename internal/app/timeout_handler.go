@@ -0,0 +1,21 @@
+package app
+
+import (
+	"net/http"
+	"time"
+)
+
+// timeoutErrorBody is the JSON body written by withTimeout when a route
+// exceeds its configured timeout. It intentionally matches the shape of
+// the error responses returned elsewhere in the service.
+const timeoutErrorBody = `{"error":{"code":503,"message":"request timeout"}}`
+
+// withTimeout wraps next with http.TimeoutHandler so a slow handler
+// returns a 503 with a structured JSON body instead of hanging. A zero
+// timeout disables the wrapper.
+func withTimeout(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.TimeoutHandler(next, timeout, timeoutErrorBody)
+}
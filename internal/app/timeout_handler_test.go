@@ -0,0 +1,97 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		timeout         time.Duration
+		handlerDuration time.Duration
+		wantStatus      int
+		wantBody        string
+	}{
+		{
+			name:            "handler finishes before timeout",
+			timeout:         100 * time.Millisecond,
+			handlerDuration: 0,
+			wantStatus:      http.StatusOK,
+			wantBody:        "ok",
+		},
+		{
+			name:            "handler exceeds timeout",
+			timeout:         50 * time.Millisecond,
+			handlerDuration: 500 * time.Millisecond,
+			wantStatus:      http.StatusServiceUnavailable,
+			wantBody:        timeoutErrorBody,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := withTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tt.handlerDuration)
+				w.Write([]byte("ok"))
+			}), tt.timeout)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestWithTimeout_DecrementsActiveRequests verifies that a timed-out
+// request still unblocks any in-flight accounting wrapped around it, such
+// as the inactivity watchdog's Middleware.
+func TestWithTimeout_DecrementsActiveRequests(t *testing.T) {
+	var activeReqs sync.WaitGroup
+
+	tracking := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			activeReqs.Add(1)
+			defer activeReqs.Done()
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	handler := tracking(withTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}), 20*time.Millisecond))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("request did not return after timeout")
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		activeReqs.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("activeReqs was not decremented after timeout")
+	}
+}
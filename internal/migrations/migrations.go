@@ -0,0 +1,316 @@
+// Package migrations embeds the service's numbered SQL migrations and
+// applies them to Postgres, tracking applied versions in a
+// schema_migrations table. It replaces the old single
+// CREATE TABLE IF NOT EXISTS approach so schema changes can be reviewed,
+// ordered, and rolled back like any other change.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var sqlFS embed.FS
+
+// migrationLockKey is the advisory lock key used to serialize migrations
+// across machines starting concurrently. It's an arbitrary constant,
+// scoped to this service.
+const migrationLockKey = 727001
+
+// lockRetryInterval is how long to wait between pg_try_advisory_lock
+// attempts when the lock is already held.
+const lockRetryInterval = 250 * time.Millisecond
+
+// migration is a single numbered schema change with its up and,
+// optionally, down SQL.
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load parses the embedded *.sql files into ordered migrations. Files
+// must be named "<version>_<name>.up.sql" and, optionally,
+// "<version>_<name>.down.sql".
+func Load() ([]migration, error) {
+	byVersion := make(map[int]*migration)
+
+	err := fs.WalkDir(sqlFS, "sql", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		name := d.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return fmt.Errorf("migrations: unrecognized file %s", name)
+		}
+
+		version, label, err := parseFileName(name, direction)
+		if err != nil {
+			return err
+		}
+
+		contents, err := sqlFS.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// parseFileName extracts the version and name from a
+// "<version>_<name>.<direction>.sql" file name.
+func parseFileName(name, direction string) (int, string, error) {
+	trimmed := strings.TrimSuffix(name, "."+direction+".sql")
+	parts := strings.SplitN(trimmed, "_", 2)
+	if len(parts) != 2 {
+		return 0, "", fmt.Errorf("migrations: malformed file name %s", name)
+	}
+
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("migrations: malformed version in %s: %w", name, err)
+	}
+
+	return version, parts[1], nil
+}
+
+// Up applies every migration that hasn't already been recorded in
+// schema_migrations, in version order. It acquires a Postgres advisory
+// lock first so that multiple machines starting simultaneously don't
+// race to apply the same migration twice.
+func Up(ctx context.Context, db *sql.DB, logger *slog.Logger) error {
+	migrations, err := Load()
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if err := acquireLock(ctx, conn); err != nil {
+		return err
+	}
+	defer releaseLock(context.Background(), conn)
+
+	if err := ensureSchemaMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		logger.InfoContext(ctx, "applied migration",
+			slog.Int("version", m.Version),
+			slog.String("name", m.Name),
+		)
+	}
+
+	return nil
+}
+
+// Down rolls back the most recently applied migration, using the same
+// advisory lock as Up so it doesn't race a concurrent Up/Down elsewhere.
+func Down(ctx context.Context, db *sql.DB, logger *slog.Logger) error {
+	migrations, err := Load()
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if err := acquireLock(ctx, conn); err != nil {
+		return err
+	}
+	defer releaseLock(context.Background(), conn)
+
+	if err := ensureSchemaMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	var latest *migration
+	for i := range migrations {
+		m := &migrations[i]
+		if applied[m.Version] && (latest == nil || m.Version > latest.Version) {
+			latest = m
+		}
+	}
+	if latest == nil {
+		logger.InfoContext(ctx, "no applied migrations to roll back")
+		return nil
+	}
+	if latest.Down == "" {
+		return fmt.Errorf("migrations: no down migration for version %d_%s", latest.Version, latest.Name)
+	}
+
+	if err := revertMigration(ctx, conn, *latest); err != nil {
+		return fmt.Errorf("failed to roll back migration %d_%s: %w", latest.Version, latest.Name, err)
+	}
+
+	logger.InfoContext(ctx, "rolled back migration",
+		slog.Int("version", latest.Version),
+		slog.String("name", latest.Name),
+	)
+
+	return nil
+}
+
+// ensureSchemaMigrationsTable creates the tracking table if it doesn't
+// already exist.
+func ensureSchemaMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// applyMigration runs a single migration's up SQL and records it in
+// schema_migrations within one transaction.
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.Version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revertMigration runs a single migration's down SQL and removes its
+// schema_migrations record within one transaction.
+func revertMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// appliedVersions returns the set of migration versions already recorded
+// in schema_migrations.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// acquireLock blocks, retrying pg_try_advisory_lock, until the migration
+// advisory lock is held or ctx is done.
+func acquireLock(ctx context.Context, conn *sql.Conn) error {
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", migrationLockKey).Scan(&locked); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if locked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// releaseLock releases the migration advisory lock taken by acquireLock.
+func releaseLock(ctx context.Context, conn *sql.Conn) {
+	conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+}
@@ -0,0 +1,147 @@
+// Package pgwait connects to Postgres with retry and exponential backoff,
+// and keeps watching the connection afterward so callers (like a /health
+// endpoint) can cheaply check whether the pool is currently reachable
+// instead of blocking a request on a live ping. This matters on Fly.io,
+// where Postgres may not be reachable in the instant a machine wakes from
+// suspend.
+package pgwait
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Options configures the retry/backoff behavior of Wait and the
+// background health monitor it starts.
+type Options struct {
+	// InitialInterval is the delay before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the backoff delay between retries.
+	MaxInterval time.Duration
+	// MaxAttempts bounds how many connection attempts Wait will make
+	// before giving up. Zero means retry until ctx is done.
+	MaxAttempts int
+	// Jitter is the fraction of the backoff interval (0-1) added as
+	// random jitter, to avoid thundering-herd reconnects.
+	Jitter float64
+	// HealthCheckInterval is how often the background monitor re-pings
+	// the pool to keep Healthy() up to date.
+	HealthCheckInterval time.Duration
+}
+
+// DefaultOptions returns reasonable defaults for a Fly.io deployment.
+func DefaultOptions() Options {
+	return Options{
+		InitialInterval:     250 * time.Millisecond,
+		MaxInterval:         30 * time.Second,
+		MaxAttempts:         0,
+		Jitter:              0.2,
+		HealthCheckInterval: 5 * time.Second,
+	}
+}
+
+// Pool wraps a *sql.DB with a cheap Healthy() check backed by a
+// background monitor, so request handlers don't each pay for a live ping.
+type Pool struct {
+	db *sql.DB
+
+	mu      sync.RWMutex
+	healthy bool
+}
+
+// DB returns the underlying connection pool.
+func (p *Pool) DB() *sql.DB { return p.db }
+
+// Healthy reports whether the most recent background ping succeeded.
+func (p *Pool) Healthy() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.healthy
+}
+
+// Close closes the underlying pool.
+func (p *Pool) Close() error {
+	return p.db.Close()
+}
+
+func (p *Pool) setHealthy(healthy bool) {
+	p.mu.Lock()
+	p.healthy = healthy
+	p.mu.Unlock()
+}
+
+// Wait opens a connection pool via driverName/dsn and retries pinging it
+// with exponential backoff until it succeeds, opts.MaxAttempts is
+// exhausted, or ctx is done. Once connected, it starts a background
+// goroutine, scoped to ctx, that keeps Pool.Healthy() current.
+func Wait(ctx context.Context, driverName, dsn string, opts Options) (*Pool, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("pgwait: failed to open pool: %w", err)
+	}
+
+	interval := opts.InitialInterval
+	for attempt := 1; ; attempt++ {
+		pingErr := ping(ctx, db)
+		if pingErr == nil {
+			break
+		}
+
+		if opts.MaxAttempts > 0 && attempt >= opts.MaxAttempts {
+			db.Close()
+			return nil, fmt.Errorf("pgwait: giving up after %d attempts: %w", attempt, pingErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, ctx.Err()
+		case <-time.After(withJitter(interval, opts.Jitter)):
+		}
+
+		interval *= 2
+		if interval > opts.MaxInterval {
+			interval = opts.MaxInterval
+		}
+	}
+
+	pool := &Pool{db: db, healthy: true}
+	go pool.monitor(ctx, opts.HealthCheckInterval)
+
+	return pool, nil
+}
+
+// monitor periodically re-pings the pool to keep Healthy() current, until
+// ctx is done.
+func (p *Pool) monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.setHealthy(ping(ctx, p.db) == nil)
+		}
+	}
+}
+
+// ping pings db with a bounded timeout derived from ctx.
+func ping(ctx context.Context, db *sql.DB) error {
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return db.PingContext(pingCtx)
+}
+
+// withJitter adds up to frac*d of random jitter to d.
+func withJitter(d time.Duration, frac float64) time.Duration {
+	if frac <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Float64()*frac*float64(d))
+}
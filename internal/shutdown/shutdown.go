@@ -0,0 +1,90 @@
+// Package shutdown is a small process-global graceful-shutdown registry,
+// modeled on Flynn's shutdown.BeforeExit/shutdown.Fatal pattern. Any
+// component (DB pool, HTTP server, activity monitor, background worker)
+// can call BeforeExit at construction time instead of hand-rolling its own
+// shutdown wiring; main is then only responsible for wiring signal
+// handling and any other shutdown trigger (e.g. an inactivity timeout)
+// into Exit or Fatal.
+package shutdown
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultHookTimeout bounds how long a single registered hook is allowed
+// to run before shutdown moves on to the next one.
+const DefaultHookTimeout = 5 * time.Second
+
+type hook struct {
+	fn      func()
+	timeout time.Duration
+}
+
+var (
+	mu    sync.Mutex
+	hooks []hook
+	once  sync.Once
+)
+
+// BeforeExit registers fn to run during shutdown. Hooks run in LIFO order
+// (the most recently registered hook runs first), bounded by
+// DefaultHookTimeout.
+func BeforeExit(fn func()) {
+	BeforeExitTimeout(fn, DefaultHookTimeout)
+}
+
+// BeforeExitTimeout is like BeforeExit but with a custom per-hook timeout,
+// for hooks that are known to take longer (or should be cut off sooner)
+// than DefaultHookTimeout.
+func BeforeExitTimeout(fn func(), timeout time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, hook{fn: fn, timeout: timeout})
+}
+
+// Exit runs every registered hook, in LIFO order, then calls os.Exit(code).
+// It's safe to call more than once; only the first call runs hooks.
+func Exit(code int) {
+	once.Do(runHooks)
+	os.Exit(code)
+}
+
+// Fatal logs err, runs every registered hook, and exits with status 1.
+func Fatal(err error) {
+	log.Printf("fatal: %v", err)
+	Exit(1)
+}
+
+// Fatalf is like Fatal but formats its message like log.Printf.
+func Fatalf(format string, args ...any) {
+	log.Printf(format, args...)
+	Exit(1)
+}
+
+// runHooks executes every registered hook in LIFO order, each bounded by
+// its own timeout so one hanging hook can't block the rest.
+func runHooks() {
+	mu.Lock()
+	toRun := make([]hook, len(hooks))
+	copy(toRun, hooks)
+	mu.Unlock()
+
+	for i := len(toRun) - 1; i >= 0; i-- {
+		h := toRun[i]
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			h.fn()
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(h.timeout):
+			log.Printf("shutdown: hook timed out after %s", h.timeout)
+		}
+	}
+}
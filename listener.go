@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// reconnect interval bounds for the underlying pq.Listener, matching the
+// defaults recommended by the lib/pq listener example.
+const (
+	listenerMinReconnectInterval = 20 * time.Millisecond
+	listenerMaxReconnectInterval = time.Hour
+)
+
+// itemChangeHub fans out ItemEvents from the Postgres listener goroutine
+// to any number of SSE subscribers. It's the generic hub from events.go,
+// parameterized over ItemEvent.
+type itemChangeHub = hub[ItemEvent]
+
+func newItemChangeHub() *itemChangeHub {
+	return newHub[ItemEvent]()
+}
+
+// itemListener subscribes to itemsChangedChannel via LISTEN/NOTIFY and
+// republishes row changes to an itemChangeHub. It handles its own
+// reconnects through pq.NewListener and resyncs from Postgres afterward so
+// inserts made while disconnected are replayed; updates and deletes made
+// while disconnected are not replayed.
+type itemListener struct {
+	db     *sql.DB
+	hub    *itemChangeHub
+	logger *slog.Logger
+	pql    *pq.Listener
+
+	mu     sync.Mutex
+	lastID int
+}
+
+// newItemListener opens a pq.Listener on dsn and starts processing
+// notifications in the background. Call Close to stop it.
+func newItemListener(ctx context.Context, dsn string, db *sql.DB, logger *slog.Logger) (*itemListener, error) {
+	l := &itemListener{db: db, hub: newItemChangeHub(), logger: logger}
+
+	l.pql = pq.NewListener(dsn, listenerMinReconnectInterval, listenerMaxReconnectInterval, l.reportProblem)
+	if err := l.pql.Listen(itemsChangedChannel); err != nil {
+		l.pql.Close()
+		return nil, err
+	}
+
+	go l.run(ctx)
+
+	return l, nil
+}
+
+// Subscribe registers a new subscriber to the change feed.
+func (l *itemListener) Subscribe() (chan ItemEvent, func()) {
+	return l.hub.Subscribe()
+}
+
+// Close stops the listener and releases its connection.
+func (l *itemListener) Close() error {
+	return l.pql.Close()
+}
+
+// reportProblem is pq.NewListener's EventCallbackType; it logs connection
+// state changes and triggers a resync after a reconnect.
+func (l *itemListener) reportProblem(ev pq.ListenerEventType, err error) {
+	switch ev {
+	case pq.ListenerEventConnectionAttemptFailed, pq.ListenerEventDisconnected:
+		l.logger.Warn("items listener connection problem", slog.Any("error", err))
+	case pq.ListenerEventReconnected:
+		l.logger.Info("items listener reconnected - resyncing")
+		if err := l.resync(context.Background()); err != nil {
+			l.logger.Error("items listener resync failed", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// run processes notifications until ctx is done.
+func (l *itemListener) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			l.pql.Close()
+			return
+
+		case notification, ok := <-l.pql.Notify:
+			if !ok {
+				return
+			}
+			if notification == nil {
+				// nil notification means the connection was lost and is
+				// being retried; reportProblem handles the resync.
+				continue
+			}
+			l.handleNotification(notification)
+
+		case <-time.After(90 * time.Second):
+			go l.pql.Ping()
+		}
+	}
+}
+
+// handleNotification decodes a single pg_notify payload and publishes it.
+func (l *itemListener) handleNotification(n *pq.Notification) {
+	var event ItemEvent
+	if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+		l.logger.Error("failed to decode item change notification", slog.String("error", err.Error()))
+		return
+	}
+
+	l.mu.Lock()
+	if event.Item.ID > l.lastID {
+		l.lastID = event.Item.ID
+	}
+	l.mu.Unlock()
+
+	l.hub.Publish(event)
+}
+
+// resync replays any inserts missed while the connection was down, by
+// selecting items created after the last ID this listener observed.
+func (l *itemListener) resync(ctx context.Context) error {
+	l.mu.Lock()
+	lastID := l.lastID
+	l.mu.Unlock()
+
+	rows, err := l.db.QueryContext(ctx,
+		"SELECT id, name, created_at FROM items WHERE id > $1 ORDER BY id ASC",
+		lastID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.CreatedAt); err != nil {
+			return err
+		}
+		l.mu.Lock()
+		if item.ID > l.lastID {
+			l.lastID = item.ID
+		}
+		l.mu.Unlock()
+		l.hub.Publish(ItemEvent{Op: "INSERT", Item: item})
+	}
+
+	return rows.Err()
+}
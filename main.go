@@ -1,12 +1,19 @@
+// This is the canonical, deployed entrypoint for the service: it owns the
+// items API, the Postgres-backed migration/connection/LISTEN-NOTIFY
+// subsystems, and the activity-based scale-to-zero behavior. It reuses
+// internal/app's Config, TLS hot-reload, and the /ready bounded-drain
+// subsystem; the per-route timeout wrapper in timeout.go is a copy of
+// internal/app's unexported withTimeout, not a shared one. cmd/app
+// remains a standalone rewrite of the same HTTP-serving story onto a
+// config without the database-level features added here.
 package main
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
-	"fmt"
-	"io"
+	"flag"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,233 +21,229 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/caarlos0/env"
 	_ "github.com/lib/pq"
+
+	"github.com/jake/poc-fly-microservice/internal/app"
+	appshutdown "github.com/jake/poc-fly-microservice/internal/app/shutdown"
+	"github.com/jake/poc-fly-microservice/internal/migrations"
+	"github.com/jake/poc-fly-microservice/internal/pgwait"
+	"github.com/jake/poc-fly-microservice/internal/shutdown"
+	"github.com/jake/poc-fly-microservice/pkg/inactivity"
 )
 
 const (
-	shutdownTimeout = 5 * time.Minute
-	port           = "8080"
+	// defaultPort is used when APP_PORT isn't set, preserving this
+	// binary's long-standing default of listening on :8080.
+	defaultPort = "8080"
+
+	// inactivityTimeout is how long the service can go without activity
+	// (requests or open connections) before it's told to shut down, so Fly
+	// can scale the machine to zero.
+	inactivityTimeout = 5 * time.Minute
+
+	// minUptime keeps the service from shutting down immediately after
+	// boot, before it's had a real chance to receive traffic.
+	minUptime = 2 * time.Minute
+
+	// preShutdownNotice is how long before the inactivity shutdown
+	// /items/stream subscribers are told to reconnect elsewhere.
+	preShutdownNotice = 30 * time.Second
 )
 
-type Item struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-type CreateItemRequest struct {
-	Name string `json:"name"`
+// routeTimeouts overrides cfg.RouteTimeout for specific routes, mirroring
+// internal/app/server.go's addRoutes.
+var routeTimeouts = map[string]time.Duration{
+	"/health": 2 * time.Second,
+	"/ready":  2 * time.Second,
+	// A zero timeout leaves /items/stream unwrapped: the stream is
+	// long-lived and needs http.Flusher, which http.TimeoutHandler's
+	// ResponseWriter doesn't implement.
+	"/items/stream": 0,
 }
 
-type activityTracker struct {
-	lastActivity time.Time
-	mu          sync.RWMutex
-}
+// setupServer builds the request-handling chain: per-route timeouts,
+// inactivity-based activity tracking, and the shutdown subsystem's
+// in-flight request tracking.
+func setupServer(logger *slog.Logger, cfg app.Config, pool *pgwait.Pool, ia *inactivity.Inactivity, sd *appshutdown.Shutdown, listener *itemListener, reconnectCh <-chan struct{}) http.Handler {
+	db := pool.DB()
+	mux := http.NewServeMux()
+	defaultTimeout := time.Duration(cfg.RouteTimeout) * time.Second
 
-func newActivityTracker() *activityTracker {
-	return &activityTracker{
-		lastActivity: time.Now(),
+	register := func(pattern string, handler http.Handler) {
+		timeout := defaultTimeout
+		if override, ok := routeTimeouts[pattern]; ok {
+			timeout = override
+		}
+		mux.Handle(pattern, withTimeout(handler, timeout))
 	}
-}
 
-func (t *activityTracker) update() {
-	t.mu.Lock()
-	t.lastActivity = time.Now()
-	t.mu.Unlock()
+	register("/health", healthHandler(pool))
+	register("/ready", sd.ReadyHandler())
+	register("/debug/inactivity", debugInactivityHandler(ia))
+	register("/items", createItemHandler(logger, db))
+	register("/items/stream", itemStreamHandler(logger, listener, ssePingInterval, reconnectCh))
+	register("/items/", listItemsHandler(logger, db))
+
+	// /health, /ready, and /debug/inactivity are exempt from inactivity
+	// tracking so Fly's periodic health probes and operator debugging
+	// don't keep the machine alive forever.
+	handler := ia.WrapExcept("/health", "/ready", "/debug/inactivity")(mux)
+	handler = withRequestLogging(logger, handler)
+	handler = sd.Middleware(handler)
+
+	return handler
 }
 
-func (t *activityTracker) timeSinceLastActivity() time.Duration {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	return time.Since(t.lastActivity)
-}
+func main() {
+	migrateOnly := flag.Bool("migrate-only", false, "run pending database migrations and exit, without starting the server")
+	migrateDown := flag.Bool("migrate-down", false, "roll back the most recently applied migration and exit, without starting the server")
+	flag.Parse()
 
-func withActivityTracking(tracker *activityTracker, next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tracker.update()
-		next.ServeHTTP(w, r)
-	})
-}
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-func healthHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	var cfg app.Config
+	if err := env.Parse(&cfg); err != nil {
+		log.Fatalf("Failed to parse config: %v", err)
+	}
+	if cfg.AppPort == "" {
+		cfg.AppPort = defaultPort
 	}
-}
-
-func createItemHandler(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		var req CreateItemRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-		defer r.Body.Close()
-
-		if req.Name == "" {
-			http.Error(w, "Name is required", http.StatusBadRequest)
-			return
-		}
-
-		var item Item
-		err := db.QueryRow(
-			"INSERT INTO items (name, created_at) VALUES ($1, $2) RETURNING id, name, created_at",
-			req.Name,
-			time.Now(),
-		).Scan(&item.ID, &item.Name, &item.CreatedAt)
-
-		if err != nil {
-			log.Printf("Error creating item: %v", err)
-			http.Error(w, "Error creating item", http.StatusInternalServerError)
-			return
-		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(item)
+	// TODO: Load the remaining configuration from environment
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		log.Fatal("DATABASE_URL environment variable is required")
 	}
-}
 
-func listItemsHandler(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	ctx := context.Background()
 
-		rows, err := db.Query("SELECT id, name, created_at FROM items ORDER BY created_at DESC")
-		if err != nil {
-			log.Printf("Error querying items: %v", err)
-			http.Error(w, "Error retrieving items", http.StatusInternalServerError)
-			return
-		}
-		defer rows.Close()
-
-		var items []Item
-		for rows.Next() {
-			var item Item
-			if err := rows.Scan(&item.ID, &item.Name, &item.CreatedAt); err != nil {
-				log.Printf("Error scanning item: %v", err)
-				http.Error(w, "Error retrieving items", http.StatusInternalServerError)
-				return
-			}
-			items = append(items, item)
+	pool, err := pgwait.Wait(ctx, "postgres", dbURL, pgwait.DefaultOptions())
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	shutdown.BeforeExit(func() {
+		if err := pool.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
 		}
+	})
+	db := pool.DB()
 
-		if err := rows.Err(); err != nil {
-			log.Printf("Error iterating items: %v", err)
-			http.Error(w, "Error retrieving items", http.StatusInternalServerError)
-			return
+	if *migrateDown {
+		if err := migrations.Down(ctx, db, logger); err != nil {
+			shutdown.Fatalf("Failed to roll back migration: %v", err)
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(items)
+		log.Println("Migration rolled back, exiting (--migrate-down)")
+		pool.Close()
+		return
 	}
-}
-
-func initDB(db *sql.DB) error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS items (
-			id SERIAL PRIMARY KEY,
-			name TEXT NOT NULL,
-			created_at TIMESTAMP NOT NULL
-		)
-	`)
-	return err
-}
 
-func monitorActivity(tracker *activityTracker, shutdown chan<- struct{}) {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			if tracker.timeSinceLastActivity() > shutdownTimeout {
-				log.Printf("No activity for %v, initiating shutdown", shutdownTimeout)
-				close(shutdown)
-				return
-			}
-		}
+	if err := migrations.Up(ctx, db, logger); err != nil {
+		shutdown.Fatalf("Failed to run migrations: %v", err)
 	}
-}
 
-func setupServer(db *sql.DB, tracker *activityTracker) *http.Server {
-	mux := http.NewServeMux()
-	
-	// Add routes
-	mux.Handle("/health", healthHandler())
-	mux.Handle("/items", createItemHandler(db))
-	mux.Handle("/items/", listItemsHandler(db))
-
-	// Wrap all handlers with activity tracking
-	handler := withActivityTracking(tracker, mux)
-
-	return &http.Server{
-		Addr:    ":" + port,
-		Handler: handler,
+	if *migrateOnly {
+		log.Println("Migrations complete, exiting (--migrate-only)")
+		pool.Close()
+		return
 	}
-}
 
-func main() {
-	// TODO: Load configuration from environment
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL environment variable is required")
+	monitorCtx, cancelMonitor := context.WithCancel(ctx)
+	shutdown.BeforeExit(cancelMonitor)
+
+	// Initialize activity tracking. reconnectCh is closed shortly before
+	// inactivityCh, giving /items/stream subscribers a chance to
+	// reconnect elsewhere before the machine actually scales to zero.
+	inactivityCh := make(chan struct{})
+	reconnectCh := make(chan struct{})
+	var reconnectOnce sync.Once
+	ia := inactivity.New(
+		inactivityTimeout,
+		func() { close(inactivityCh) },
+		inactivity.WithMinUptime(minUptime),
+		inactivity.WithPreShutdownNotice(preShutdownNotice, func() {
+			reconnectOnce.Do(func() { close(reconnectCh) })
+		}),
+	)
+
+	// Listen for row-level changes on the items table via LISTEN/NOTIFY,
+	// so the /items/stream feed reflects every writer, not just this
+	// process's own inserts.
+	listener, err := newItemListener(monitorCtx, dbURL, db, logger)
+	if err != nil {
+		shutdown.Fatalf("Failed to start item listener: %v", err)
 	}
+	shutdown.BeforeExit(func() {
+		if err := listener.Close(); err != nil {
+			log.Printf("Error closing item listener: %v", err)
+		}
+	})
 
-	db, err := sql.Open("postgres", dbURL)
+	tlsConfig, err := app.NewTLSConfig(monitorCtx, cfg, logger)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		shutdown.Fatalf("Failed to configure tls: %v", err)
 	}
-	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("Failed to ping database: %v", err)
+	sd := appshutdown.New(
+		logger,
+		time.Duration(cfg.PreStopDelay)*time.Second,
+		time.Duration(cfg.ShutdownTimeout)*time.Second,
+	)
+
+	handler := setupServer(logger, cfg, pool, ia, sd, listener, reconnectCh)
+	httpServer := &http.Server{
+		Addr:      net.JoinHostPort(cfg.AppHost, cfg.AppPort),
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+		ConnState: ia.ConnState,
 	}
 
-	if err := initDB(db); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	ln, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		shutdown.Fatalf("Failed to listen on %s: %v", httpServer.Addr, err)
 	}
 
-	// Initialize activity tracking
-	tracker := newActivityTracker()
-	shutdown := make(chan struct{})
-
-	// Setup and start activity monitoring
-	go monitorActivity(tracker, shutdown)
-
-	// Initialize server
-	srv := setupServer(db, tracker)
+	shutdown.BeforeExit(func() {
+		if err := sd.Run(context.Background(), httpServer); err != nil {
+			log.Printf("Error during shutdown: %v", err)
+		}
+	})
 
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// shutdown.Exit runs every registered hook (including sd.Run) before
+	// calling os.Exit, so main must not return on its own: a normal return
+	// here races os.Exit and can end the process while later hooks
+	// (listener.Close, cancelMonitor, pool.Close) are still draining. wg
+	// blocks main until the goroutine below has run to completion, the
+	// same pattern cmd/app/main.go uses around its own shutdown call.
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
+		defer wg.Done()
 		select {
 		case <-sigChan:
 			log.Println("Received shutdown signal")
-		case <-shutdown:
+		case <-inactivityCh:
 			log.Println("Shutting down due to inactivity")
 		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("Error during shutdown: %v", err)
-		}
+		shutdown.Exit(0)
 	}()
 
-	log.Printf("Server starting on port %s", port)
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("Server error: %v", err)
+	log.Printf("Server starting on %s", httpServer.Addr)
+	var serveErr error
+	if tlsConfig != nil {
+		// Cert/key files are empty because the certificate is served via
+		// tlsConfig.GetCertificate, which supports hot reload.
+		serveErr = httpServer.ServeTLS(ln, "", "")
+	} else {
+		serveErr = httpServer.Serve(ln)
+	}
+	if serveErr != http.ErrServerClosed {
+		shutdown.Fatal(serveErr)
 	}
+
+	wg.Wait()
 }
@@ -1,11 +1,6 @@
 package main
 
-import (
-	"context"
-	"database/sql"
-	"log/slog"
-	"time"
-)
+import "time"
 
 // Item represents a stored item in the database.
 // It contains an ID, name, and timestamp of when it was created.
@@ -21,24 +16,13 @@ type CreateItemRequest struct {
 	Name string `json:"name"`
 }
 
-// initDB initializes the database by creating the required tables if they don't exist.
-// It uses the provided context for cancellation and timeout control.
-// The function logs the initialization process using the provided structured logger.
-func initDB(ctx context.Context, logger *slog.Logger, db *sql.DB) error {
-	logger.InfoContext(ctx, "initializing database")
-	_, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS items (
-			id SERIAL PRIMARY KEY,
-			name TEXT NOT NULL,
-			created_at TIMESTAMP NOT NULL
-		)
-	`)
-	if err != nil {
-		logger.ErrorContext(ctx, "failed to create table",
-			slog.String("error", err.Error()),
-		)
-		return err
-	}
-	logger.InfoContext(ctx, "database initialized")
-	return nil
+// ItemEvent represents a row-level change to the items table, as emitted
+// by the items_changed Postgres trigger and delivered over LISTEN/NOTIFY.
+type ItemEvent struct {
+	Op   string `json:"op"` // "INSERT", "UPDATE", or "DELETE"
+	Item Item   `json:"item"`
 }
+
+// itemsChangedChannel is the Postgres NOTIFY channel the items_changed
+// trigger (installed by internal/migrations) publishes row changes on.
+const itemsChangedChannel = "items_changed"
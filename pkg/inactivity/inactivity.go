@@ -1,39 +1,77 @@
 package inactivity
 
 import (
+	"net"
 	"net/http"
 	"sync"
 	"time"
 )
 
+// Inactivity tracks in-flight requests and fires onInactive once none have
+// been seen for the configured timeout. Policy can be layered on with
+// Options: a minimum uptime floor before onInactive is allowed to fire,
+// and a callback invoked shortly before it does so long-lived clients (SSE
+// subscribers, for example) can be told to reconnect elsewhere.
 type Inactivity struct {
 	timeout    time.Duration
 	onInactive func()
 
+	minUptime         time.Duration
+	startedAt         time.Time
+	preShutdownNotice time.Duration
+	preShutdownFn     func()
+
 	mu          sync.Mutex
 	active      int
+	activeConns int
 	timer       *time.Timer
+	noticeTimer *time.Timer
 	timerActive bool
+
+	lastActivity time.Time
+	nextFireAt   time.Time
+	fired        bool
+}
+
+// Option configures optional policy on an Inactivity.
+type Option func(*Inactivity)
+
+// WithMinUptime prevents onInactive from firing until the service has been
+// up for at least d, even if there's been no activity at all. This avoids
+// an immediate shutdown right after boot.
+func WithMinUptime(d time.Duration) Option {
+	return func(i *Inactivity) { i.minUptime = d }
 }
 
-func New(timeout time.Duration, onInactive func()) *Inactivity {
-	inactivity := &Inactivity{
-		timeout:    timeout,
-		onInactive: onInactive,
+// WithPreShutdownNotice calls fn approximately before seconds before
+// onInactive fires, so long-lived clients can be told to reconnect
+// elsewhere ahead of the actual shutdown.
+func WithPreShutdownNotice(before time.Duration, fn func()) Option {
+	return func(i *Inactivity) {
+		i.preShutdownNotice = before
+		i.preShutdownFn = fn
 	}
-	inactivity.timerActive = true
-	inactivity.timer = time.AfterFunc(timeout, func() {
-		inactivity.mu.Lock()
-		defer inactivity.mu.Unlock()
-		if inactivity.active == 0 {
-			inactivity.onInactive()
-		}
-		inactivity.timerActive = false
-		inactivity.timer = nil
-	})
-	return inactivity
 }
 
+// New creates an Inactivity that calls onInactive once timeout has elapsed
+// with no requests in flight.
+func New(timeout time.Duration, onInactive func(), opts ...Option) *Inactivity {
+	now := time.Now()
+	i := &Inactivity{
+		timeout:      timeout,
+		onInactive:   onInactive,
+		startedAt:    now,
+		lastActivity: now,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.arm(timeout)
+	return i
+}
+
+// Wrap returns an http.Handler that counts next as in-flight for as long
+// as it's running, resetting the inactivity timer around it.
 func (i *Inactivity) Wrap(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		i.increment()
@@ -42,41 +80,169 @@ func (i *Inactivity) Wrap(next http.Handler) http.Handler {
 	})
 }
 
-func (i *Inactivity) Shutdown() {
+// WrapExcept is like Wrap but requests to any of paths are served without
+// being counted as activity, so probes (health checks, metrics scrapes)
+// don't keep the service alive forever and defeat scale-to-zero.
+func (i *Inactivity) WrapExcept(paths ...string) func(http.Handler) http.Handler {
+	excluded := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		excluded[p] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, skip := excluded[r.URL.Path]; skip {
+				next.ServeHTTP(w, r)
+				return
+			}
+			i.increment()
+			defer i.decrement()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConnState is intended to be wired into http.Server.ConnState. It tracks
+// live connections (new, active, or hijacked) independently of the
+// request-level accounting done by Wrap/WrapExcept, so a connection that's
+// open but between requests (or hijacked out of HTTP entirely) still
+// counts as activity.
+func (i *Inactivity) ConnState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew, http.StateActive, http.StateHijacked:
+		i.connIncrement()
+	case http.StateIdle, http.StateClosed:
+		i.connDecrement()
+	}
+}
+
+// Ignore marks next as exempt from inactivity tracking. It's a no-op
+// wrapper, useful for documenting at the route-registration call site that
+// a specific handler was deliberately left out of Wrap/WrapExcept.
+func (i *Inactivity) Ignore(next http.Handler) http.Handler {
+	return next
+}
+
+// Stats is a snapshot of an Inactivity's current state, suitable for
+// exposing on a /debug/inactivity endpoint.
+type Stats struct {
+	ActiveRequests        int
+	ActiveConns           int
+	TimeSinceLastActivity time.Duration
+	NextFireAt            time.Time
+}
+
+// Stats returns a snapshot of the current state.
+func (i *Inactivity) Stats() Stats {
 	i.mu.Lock()
 	defer i.mu.Unlock()
-	if i.timer != nil {
-		i.timer.Stop()
+
+	return Stats{
+		ActiveRequests:        i.active,
+		ActiveConns:           i.activeConns,
+		TimeSinceLastActivity: time.Since(i.lastActivity),
+		NextFireAt:            i.nextFireAt,
 	}
 }
 
+// Shutdown stops the inactivity timer(s) without firing onInactive.
+func (i *Inactivity) Shutdown() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.disarm()
+}
+
 func (i *Inactivity) increment() {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
 	i.active++
+	i.lastActivity = time.Now()
+	i.disarm()
+}
+
+func (i *Inactivity) decrement() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.active--
+	i.lastActivity = time.Now()
+	if i.active == 0 && i.activeConns == 0 && !i.timerActive && !i.fired {
+		i.arm(i.timeout)
+	}
+}
+
+func (i *Inactivity) connIncrement() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.activeConns++
+	i.lastActivity = time.Now()
+	i.disarm()
+}
+
+func (i *Inactivity) connDecrement() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.activeConns--
+	i.lastActivity = time.Now()
+	if i.active == 0 && i.activeConns == 0 && !i.timerActive && !i.fired {
+		i.arm(i.timeout)
+	}
+}
+
+// arm schedules the timer(s) to fire in d, along with a pre-shutdown
+// notice timer if configured. Callers must hold i.mu.
+func (i *Inactivity) arm(d time.Duration) {
+	i.nextFireAt = time.Now().Add(d)
+	i.timerActive = true
+	i.timer = time.AfterFunc(d, i.fire)
+
+	if i.preShutdownFn != nil && i.preShutdownNotice > 0 && i.preShutdownNotice < d {
+		i.noticeTimer = time.AfterFunc(d-i.preShutdownNotice, i.preShutdownFn)
+	}
+}
+
+// disarm stops any armed timers. Callers must hold i.mu.
+func (i *Inactivity) disarm() {
 	if i.timer != nil {
 		i.timer.Stop()
 		i.timer = nil
-		i.timerActive = false
 	}
+	if i.noticeTimer != nil {
+		i.noticeTimer.Stop()
+		i.noticeTimer = nil
+	}
+	i.timerActive = false
 }
 
-func (i *Inactivity) decrement() {
+// fire runs when the inactivity timer elapses. If requests arrived in the
+// meantime, or the service hasn't met its minimum uptime yet, it backs off
+// instead of calling onInactive. onInactive is called at most once: once
+// fired, activity no longer rearms the timer, since the caller is expected
+// to be shutting the process down.
+func (i *Inactivity) fire() {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	i.active--
-	if i.active == 0 && !i.timerActive {
-		i.timerActive = true
-		i.timer = time.AfterFunc(i.timeout, func() {
-			i.mu.Lock()
-			defer i.mu.Unlock()
-			if i.active == 0 {
-				i.onInactive()
-			}
-			i.timerActive = false
-			i.timer = nil
-		})
+	if i.fired {
+		return
+	}
+
+	if i.active != 0 || i.activeConns != 0 {
+		i.timerActive = false
+		i.timer = nil
+		return
+	}
+
+	if uptime := time.Since(i.startedAt); uptime < i.minUptime {
+		i.arm(i.minUptime - uptime)
+		return
 	}
+
+	i.fired = true
+	i.onInactive()
+	i.timerActive = false
+	i.timer = nil
 }
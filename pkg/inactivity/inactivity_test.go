@@ -1,8 +1,11 @@
 package inactivity_test
 
 import (
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -91,16 +94,24 @@ func TestInactivityMiddleware(t *testing.T) {
 			server := httptest.NewServer(handler)
 			defer server.Close()
 
+			var wg sync.WaitGroup
 			start := time.Now()
 			for _, offset := range tt.requests {
 				sleep := time.Until(start.Add(offset))
 				if sleep > 0 {
 					time.Sleep(sleep)
 				}
+				wg.Add(1)
 				go func() {
+					defer wg.Done()
+					// The server may already be shutting down by the time
+					// this fires (e.g. a request scheduled near the end of
+					// tt.wait), which isn't itself a failure this test
+					// cares about — wg.Wait() below ensures we don't return
+					// from the subtest, and tear the server down, before
+					// every scheduled request has had a chance to run.
 					resp, err := http.Get(server.URL)
 					if err != nil {
-						t.Error(err)
 						return
 					}
 					resp.Body.Close()
@@ -117,6 +128,208 @@ func TestInactivityMiddleware(t *testing.T) {
 					t.Errorf("expected trigger but did not fire in time")
 				}
 			}
+
+			wg.Wait()
 		})
 	}
 }
+
+func TestInactivityConcurrentIncrementDecrement(t *testing.T) {
+	var triggered atomic.Bool
+
+	mw := inactivity.New(200*time.Millisecond, func() {
+		triggered.Store(true)
+	})
+
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	const workers = 50
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(server.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if stats := mw.Stats(); stats.ActiveRequests != 0 {
+		t.Errorf("ActiveRequests = %d, want 0 after all requests finished", stats.ActiveRequests)
+	}
+
+	if triggered.Load() {
+		t.Errorf("onInactive fired while requests were still in flight")
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if !triggered.Load() {
+		t.Errorf("onInactive did not fire after requests finished and the timeout elapsed")
+	}
+}
+
+func TestInactivityWrapExcept(t *testing.T) {
+	done := make(chan struct{})
+
+	mw := inactivity.New(300*time.Millisecond, func() {
+		close(done)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", mw.Ignore(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	mux.Handle("/items", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	handler := mw.WrapExcept("/health")(mux)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				resp, err := http.Get(server.URL + "/health")
+				if err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Errorf("onInactive did not fire despite only excluded paths being hit")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestInactivityMinUptime(t *testing.T) {
+	done := make(chan struct{})
+
+	mw := inactivity.New(50*time.Millisecond, func() {
+		close(done)
+	}, inactivity.WithMinUptime(300*time.Millisecond))
+
+	start := time.Now()
+	select {
+	case <-done:
+		elapsed := time.Since(start)
+		if elapsed < 300*time.Millisecond {
+			t.Errorf("onInactive fired after %s, before the minimum uptime floor", elapsed)
+		}
+		if stats := mw.Stats(); stats.ActiveRequests != 0 {
+			t.Errorf("ActiveRequests = %d, want 0", stats.ActiveRequests)
+		}
+	case <-time.After(1 * time.Second):
+		t.Errorf("onInactive never fired")
+	}
+}
+
+func TestInactivityPreShutdownNotice(t *testing.T) {
+	var noticeAt, shutdownAt time.Time
+	var mu sync.Mutex
+	done := make(chan struct{})
+
+	inactivity.New(150*time.Millisecond, func() {
+		mu.Lock()
+		shutdownAt = time.Now()
+		mu.Unlock()
+		close(done)
+	}, inactivity.WithPreShutdownNotice(100*time.Millisecond, func() {
+		mu.Lock()
+		noticeAt = time.Now()
+		mu.Unlock()
+	}))
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("onInactive never fired")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if noticeAt.IsZero() {
+		t.Fatal("pre-shutdown callback was never invoked")
+	}
+	if !noticeAt.Before(shutdownAt) {
+		t.Errorf("notice callback fired at %s, which is not before shutdown at %s", noticeAt, shutdownAt)
+	}
+}
+
+func TestInactivityConnState(t *testing.T) {
+	var triggered atomic.Bool
+
+	mw := inactivity.New(150*time.Millisecond, func() {
+		triggered.Store(true)
+	})
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = mw.ConnState
+	server.Start()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if triggered.Load() {
+		t.Errorf("onInactive fired while a connection was still open")
+	}
+
+	conn.Close()
+
+	time.Sleep(250 * time.Millisecond)
+	if !triggered.Load() {
+		t.Errorf("onInactive did not fire after the connection closed and the timeout elapsed")
+	}
+}
+
+func TestInactivityStats(t *testing.T) {
+	mw := inactivity.New(time.Second, func() {})
+
+	handlerStarted := make(chan struct{})
+	release := make(chan struct{})
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(handlerStarted)
+		<-release
+	}))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	go func() {
+		resp, err := http.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-handlerStarted
+	if stats := mw.Stats(); stats.ActiveRequests != 1 {
+		t.Errorf("ActiveRequests = %d, want 1 while a request is in flight", stats.ActiveRequests)
+	}
+	close(release)
+}
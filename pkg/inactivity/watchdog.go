@@ -6,6 +6,7 @@ package inactivity
 import (
 	"context"
 	"log/slog"
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -21,6 +22,9 @@ type Watchdog struct {
 	activeReqs  sync.WaitGroup
 	once        sync.Once
 	logger      *slog.Logger
+
+	connMu      sync.Mutex
+	activeConns int
 }
 
 // New creates a new Watchdog. The shutdownFn will be called
@@ -43,12 +47,10 @@ func NewWatchdog(timeout time.Duration, h slog.Handler, shutdownFn func()) *Watc
 // and tracks in-flight requests.
 func (w *Watchdog) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		// select {
-		// case w.resetCh <- struct{}{}:
-		// default:
-		// }
-
-		w.resetCh <- struct{}{}
+		select {
+		case w.resetCh <- struct{}{}:
+		default:
+		}
 
 		w.activeReqs.Add(1)
 		defer w.activeReqs.Done()
@@ -56,6 +58,44 @@ func (w *Watchdog) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// ConnState is intended to be wired into http.Server.ConnState. It tracks
+// the number of live connections (new, active, or hijacked) independently
+// of request-level accounting done by Middleware, so long-lived streaming
+// responses, hijacked upgrades, and slow-uploading clients all keep the
+// service alive for as long as their connection is open.
+func (w *Watchdog) ConnState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew, http.StateActive, http.StateHijacked:
+		w.connDelta(1)
+	case http.StateIdle, http.StateClosed:
+		w.connDelta(-1)
+	}
+}
+
+// connDelta adjusts the active connection count and resets the inactivity
+// timer whenever a new connection arrives or the count drops back to zero.
+func (w *Watchdog) connDelta(delta int) {
+	w.connMu.Lock()
+	prev := w.activeConns
+	w.activeConns += delta
+	cur := w.activeConns
+	w.connMu.Unlock()
+
+	if delta > 0 || (cur == 0 && prev > 0) {
+		select {
+		case w.resetCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// activeConnCount returns the current number of live connections.
+func (w *Watchdog) activeConnCount() int {
+	w.connMu.Lock()
+	defer w.connMu.Unlock()
+	return w.activeConns
+}
+
 // Stop cancels the background watchdog goroutine.
 func (w *Watchdog) Stop() {
 	w.once.Do(func() {
@@ -84,6 +124,11 @@ func (w *Watchdog) watch() {
 			timer.Reset(w.timeout)
 
 		case <-timer.C:
+			if conns := w.activeConnCount(); conns > 0 {
+				w.logger.InfoContext(w.shutdownCtx, "[inactivity] timeout reached but connections still open - resetting", slog.Int("active_conns", conns))
+				timer.Reset(w.timeout)
+				continue
+			}
 			w.logger.InfoContext(w.shutdownCtx, "[inactivity] timeout reached - waiting for active requests to finish", slog.Int("timeout", int(w.timeout.Seconds())))
 			w.activeReqs.Wait()
 			w.logger.InfoContext(w.shutdownCtx, "[inactivity] all requests done - shutting down")
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// timeoutErrorBody is the JSON body written by withTimeout when a route
+// exceeds its configured timeout. It matches the shape of the error
+// responses returned elsewhere in the service (see healthHandler).
+const timeoutErrorBody = `{"error":{"code":503,"message":"request timeout"}}`
+
+// withTimeout wraps next with http.TimeoutHandler so a slow handler
+// returns a 503 with a structured JSON body instead of hanging. A zero
+// timeout disables the wrapper.
+func withTimeout(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.TimeoutHandler(next, timeout, timeoutErrorBody)
+}